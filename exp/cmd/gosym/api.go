@@ -0,0 +1,216 @@
+package main
+
+import (
+	"code.google.com/p/rog-go/exp/go/ast"
+	"code.google.com/p/rog-go/exp/go/token"
+	"code.google.com/p/rog-go/exp/go/types"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	apiMode   = flag.Bool("api", false, "print exported-API signatures instead of references")
+	apiCheck  = flag.String("check", "", "compare the -api output against a previous dump from this file")
+	apiStrict = flag.Bool("strict", false, "with -check, also fail when symbols are added")
+)
+
+// apiEntry is one line of the -api dump: a single exported symbol,
+// in the canonical form "pkgpath.Name kind signature".
+type apiEntry struct {
+	pkg  string
+	kind string // "const", "var", "type", "field", "func" or "method"
+	recv string // receiver (or struct) type name, for methods and fields
+	name string
+	sig  string
+}
+
+func (e apiEntry) String() string {
+	name := e.name
+	if e.recv != "" {
+		name = e.recv + "." + e.name
+	}
+	return fmt.Sprintf("%s.%s %s %s", e.pkg, name, e.kind, e.sig)
+}
+
+type byName []apiEntry
+
+func (a byName) Len() int      { return len(a) }
+func (a byName) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool {
+	if a[i].pkg != a[j].pkg {
+		return a[i].pkg < a[j].pkg
+	}
+	if a[i].recv != a[j].recv {
+		return a[i].recv < a[j].recv
+	}
+	return a[i].name < a[j].name
+}
+
+// runAPI implements the "-api" mode: it prints one line per exported
+// symbol reachable from pkgs, or, with -check, compares that set against
+// a previous dump and exits non-zero on removals (and, with -strict, on
+// additions too).
+func runAPI(ctxt *context, pkgs []string) {
+	var entries []apiEntry
+	for _, path := range pkgs {
+		pkg := ctxt.importer(path)
+		if pkg == nil {
+			continue
+		}
+		for _, f := range pkg.Files {
+			entries = append(entries, apiEntries(ctxt, path, f)...)
+		}
+	}
+	sort.Sort(byName(entries))
+	if *apiCheck != "" {
+		old, err := readAPIFile(*apiCheck)
+		if err != nil {
+			log.Fatalf("gosym -check: %v", err)
+		}
+		if !diffAPI(old, entries, *apiStrict) {
+			os.Exit(1)
+		}
+		return
+	}
+	for _, e := range entries {
+		fmt.Println(e)
+	}
+}
+
+func apiEntries(ctxt *context, path string, f *ast.File) []apiEntry {
+	var entries []apiEntry
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range s.Names {
+						if !name.IsExported() {
+							continue
+						}
+						entries = append(entries, apiEntry{
+							pkg:  path,
+							kind: kind,
+							name: name.Name,
+							sig:  exprTypeString(ctxt, name),
+						})
+					}
+				case *ast.TypeSpec:
+					if !s.Name.IsExported() {
+						continue
+					}
+					entries = append(entries, apiEntry{
+						pkg:  path,
+						kind: "type",
+						name: s.Name.Name,
+						sig:  (pretty{s.Type}).String(),
+					})
+					entries = append(entries, fieldEntries(path, s)...)
+				}
+			}
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			recv := ""
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				recv = (pretty{depointer(d.Recv.List[0].Type)}).String()
+			}
+			kind := "func"
+			if recv != "" {
+				kind = "method"
+			}
+			entries = append(entries, apiEntry{
+				pkg:  path,
+				kind: kind,
+				recv: recv,
+				name: d.Name.Name,
+				sig:  (pretty{d.Type}).String(),
+			})
+		}
+	}
+	return entries
+}
+
+// fieldEntries expands the exported fields of a struct type. byName then
+// sorts these, along with every other entry, into a stable order keyed
+// on (pkg, recv, name) - so the dump is deterministic across runs - which
+// means a field reorder with no other change is not visible in it.
+func fieldEntries(path string, s *ast.TypeSpec) []apiEntry {
+	st, ok := s.Type.(*ast.StructType)
+	if !ok {
+		return nil
+	}
+	var entries []apiEntry
+	for _, field := range st.Fields.List {
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+			entries = append(entries, apiEntry{
+				pkg:  path,
+				kind: "field",
+				recv: s.Name.Name,
+				name: name.Name,
+				sig:  (pretty{field.Type}).String(),
+			})
+		}
+	}
+	return entries
+}
+
+func exprTypeString(ctxt *context, e ast.Expr) string {
+	_, t := types.ExprType(e, ctxt.importer)
+	if t.Node == nil {
+		return "?"
+	}
+	return (pretty{t.Node}).String()
+}
+
+func readAPIFile(name string) ([]string, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n"), nil
+}
+
+// diffAPI reports removals (and, if strict, additions) between an old
+// dump and the current set of entries, printing a line for each and
+// returning whether the two are compatible.
+func diffAPI(old []string, entries []apiEntry, strict bool) bool {
+	newSet := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		newSet[e.String()] = true
+	}
+	ok := true
+	for _, l := range old {
+		if l != "" && !newSet[l] {
+			fmt.Printf("-%s\n", l)
+			ok = false
+		}
+	}
+	if strict {
+		oldSet := make(map[string]bool, len(old))
+		for _, l := range old {
+			oldSet[l] = true
+		}
+		for _, e := range entries {
+			if !oldSet[e.String()] {
+				fmt.Printf("+%s\n", e)
+				ok = false
+			}
+		}
+	}
+	return ok
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+// TestByNameSortsByPkgRecvName guards the fieldEntries doc comment's
+// claim: byName sorts every entry into a stable order keyed on
+// (pkg, recv, name), so a field reorder with no other change is not
+// observable in the -api dump, regardless of the order entries were
+// appended in.
+func TestByNameSortsByPkgRecvName(t *testing.T) {
+	entries := []apiEntry{
+		{pkg: "p", recv: "T", name: "Z", kind: "field", sig: "int"},
+		{pkg: "p", recv: "T", name: "A", kind: "field", sig: "int"},
+	}
+	sort.Sort(byName(entries))
+	if entries[0].name != "A" || entries[1].name != "Z" {
+		t.Fatalf("got order %v, want fields sorted by name regardless of declaration order", entries)
+	}
+
+	reversed := []apiEntry{entries[1], entries[0]}
+	sort.Sort(byName(reversed))
+	if reversed[0].name != "A" || reversed[1].name != "Z" {
+		t.Fatalf("got order %v, want the same sorted order independent of input order", reversed)
+	}
+
+	mixed := []apiEntry{
+		{pkg: "q", name: "A", kind: "func", sig: "func()"},
+		{pkg: "p", recv: "T", name: "A", kind: "field", sig: "int"},
+		{pkg: "p", name: "T", kind: "type", sig: "struct{}"},
+	}
+	sort.Sort(byName(mixed))
+	if mixed[0].pkg != "p" || mixed[0].recv != "" || mixed[1].pkg != "p" || mixed[1].recv != "T" || mixed[2].pkg != "q" {
+		t.Fatalf("got order %v, want pkg first, then recv, then name", mixed)
+	}
+}
@@ -14,18 +14,19 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"regexp"
 	"sync"
 )
 
-// TODO allow changing of package identifiers too.
 var objKinds = map[string]ast.ObjKind{
-	"const": ast.Con,
-	"type":  ast.Typ,
-	"var":   ast.Var,
-	"func":  ast.Fun,
+	"const":   ast.Con,
+	"type":    ast.Typ,
+	"var":     ast.Var,
+	"func":    ast.Fun,
+	"package": ast.Pkg,
 }
 
 var (
@@ -33,9 +34,15 @@ var (
 	kinds   = flag.String("k", allKinds(), "kinds of symbol types to include")
 	printType = flag.Bool("t", false, "print symbol type")
 	all = flag.Bool("a", false, "print internal and universe symbols too")
+	localsOnly = flag.Bool("locals-only", false, "print only function-local symbols")
+	numWorkers = flag.Int("p", runtime.GOMAXPROCS(0), "number of packages to import concurrently (resolution itself is always serialized)")
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "rename" {
+		runRename(os.Args[2:])
+		return
+	}
 	printf := func(f string, a ...interface{}) { fmt.Fprintf(os.Stderr, f, a...) }
 	flag.Usage = func() {
 		printf("usage: gosym [flags] pkgpath...\n")
@@ -45,6 +52,10 @@ func main() {
 		os.Exit(2)
 	}
 	flag.Parse()
+	if *jsonlIn != "" {
+		runJSONLIn(*jsonlIn)
+		return
+	}
 	if flag.NArg() < 1 || *kinds == "" {
 		flag.Usage()
 	}
@@ -54,41 +65,126 @@ func main() {
 		printf("gosym: %v", err)
 		flag.Usage()
 	}
+	format, err := resolveOutputFormat(*memberMode)
+	if err != nil {
+		printf("gosym: %v\n", err)
+		flag.Usage()
+	}
 	initGoPath()
 
 	ctxt := newContext()
-	visitor := func(info *symInfo) bool {
-		return visitPrint(ctxt, info, mask)
-	}
 	types.Panic = false
+	if *apiMode {
+		runAPI(ctxt, pkgs)
+		return
+	}
+	analyze(ctxt, pkgs, mask, format, *numWorkers, func(l string) { fmt.Println(l) })
+}
+
+// analyze imports and visits pkgs across up to workers packages at once,
+// passing every formatted line produced to out. out is only ever called
+// from a single writer goroutine draining a channel, so it need not be
+// safe for concurrent use; the lines of one file keep their order and
+// are not interleaved with another file's, but the order of packages is
+// whichever order workers reach them in. It is the same worker-pool path main uses, pulled
+// out so BenchmarkAnalyze can drive it directly with varying workers.
+func analyze(ctxt *context, pkgs []string, mask uint, format string, workers int, out func(string)) {
+	lines := make(chan string)
+	writerDone := make(chan struct{})
+	go func() {
+		for l := range lines {
+			out(l)
+		}
+		close(writerDone)
+	}()
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
 	for _, path := range pkgs {
-		if pkg := ctxt.importer(path); pkg != nil {
+		path := path
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			pkg := ctxt.importer(path)
+			if pkg == nil {
+				return
+			}
+			visitor := func(info *symInfo) bool {
+				var line string
+				var ok bool
+				if format == "json" {
+					line, ok = formatJSON(ctxt, info, mask)
+				} else {
+					line, ok = formatLine(ctxt, info, mask)
+				}
+				if ok {
+					if *memberMode && shouldPrint(info, mask) {
+						for _, m := range memberLines(ctxt, info) {
+							line += "\n" + m
+						}
+					}
+					lines <- line
+				}
+				return true
+			}
 			for _, f := range pkg.Files {
+				// visitExprs lazily resolves and mutates Obj pointers on
+				// ASTs shared (via ctxt.importer's cache) with every other
+				// worker visiting a package that imports the same
+				// dependency, so resolution must be serialized even though
+				// importing runs concurrently.
+				ctxt.resolveMu.Lock()
 				ctxt.visitExprs(visitor, path, f, mask)
+				ctxt.resolveMu.Unlock()
 			}
-		}
+		}()
 	}
+	wg.Wait()
+	close(lines)
+	<-writerDone
 }
 
 type context struct {
-	mu sync.Mutex
+	mu       sync.Mutex
+	once     map[string]*sync.Once
 	pkgCache map[string]*ast.Package
 	importer func(path string) *ast.Package
+
+	// resolveMu serializes visitExprs/visitExpr across workers: they
+	// lazily mutate Obj pointers on ASTs that pkgCache may hand to more
+	// than one worker (any dependency shared between packages), which
+	// the underlying types package is not documented as safe for
+	// concurrent use. Only importing - the I/O-bound part - runs with
+	// the worker pool's full concurrency.
+	resolveMu sync.Mutex
 }
 
 func newContext() *context {
-	ctxt := &context {
+	ctxt := &context{
+		once:     make(map[string]*sync.Once),
 		pkgCache: make(map[string]*ast.Package),
 	}
-	ctxt.importer =  func(path string) *ast.Package {
+	ctxt.importer = func(path string) *ast.Package {
 		ctxt.mu.Lock()
-		defer ctxt.mu.Unlock()
-		if pkg := ctxt.pkgCache[path]; pkg != nil {
-			return pkg
+		once := ctxt.once[path]
+		if once == nil {
+			once = new(sync.Once)
+			ctxt.once[path] = once
 		}
-		pkg := types.DefaultImporter(path)
-		ctxt.pkgCache[path] = pkg
-		return pkg
+		ctxt.mu.Unlock()
+
+		once.Do(func() {
+			pkg := types.DefaultImporter(path)
+			ctxt.mu.Lock()
+			ctxt.pkgCache[path] = pkg
+			ctxt.mu.Unlock()
+		})
+
+		ctxt.mu.Lock()
+		defer ctxt.mu.Unlock()
+		return ctxt.pkgCache[path]
 	}
 	return ctxt
 }
@@ -141,10 +237,33 @@ func (f astVisitor) Visit(n ast.Node) ast.Visitor {
 	return nil
 }
 
+// funcRange is the [Pos,End) extent of a *ast.FuncDecl or *ast.FuncLit,
+// used to recognize identifiers declared inside it (parameters, named
+// results, and anything declared in the body) as function-local. obj is
+// the *ast.FuncDecl's own object (nil for a *ast.FuncLit, which has
+// none): a reference to it - including a recursive call - names a
+// package-level function, not a local, even from inside its own range.
+type funcRange struct {
+	start, end token.Pos
+	obj        *ast.Object
+}
+
+func inFuncScope(referObj *ast.Object, pos token.Pos, scopes []funcRange) bool {
+	for _, r := range scopes {
+		if r.obj != nil && r.obj == referObj {
+			continue
+		}
+		if pos >= r.start && pos < r.end {
+			return true
+		}
+	}
+	return false
+}
+
 func (ctxt *context) visitExprs(visitf func(*symInfo) bool, importPath string, pkg *ast.File, kindMask uint) {
 	var visit astVisitor
 	ok := true
-	local := false		// TODO set to true inside function body
+	var scopes []funcRange
 	visit = func(n ast.Node) bool {
 		if !ok {
 			return false
@@ -165,10 +284,27 @@ func (ctxt *context) visitExprs(visitf func(*symInfo) bool, importPath string, p
 			if n.Recv == nil && n.Name.Name == "init" {
 				n.Name.Obj = ast.NewObj(ast.Fun, "init")
 			}
-			return true
+			ast.Walk(visit, n.Name)
+			scopes = append(scopes, funcRange{n.Pos(), n.End(), n.Name.Obj})
+			ast.Walk(visit, n.Type)
+			if n.Recv != nil {
+				ast.Walk(visit, n.Recv)
+			}
+			if n.Body != nil {
+				ast.Walk(visit, n.Body)
+			}
+			scopes = scopes[:len(scopes)-1]
+			return false
+
+		case *ast.FuncLit:
+			scopes = append(scopes, funcRange{n.Pos(), n.End(), nil})
+			ast.Walk(visit, n.Type)
+			ast.Walk(visit, n.Body)
+			scopes = scopes[:len(scopes)-1]
+			return false
 
 		case *ast.Ident:
-			ok = ctxt.visitExpr(visitf, importPath, n, local)
+			ok = ctxt.visitExpr(visitf, importPath, n, scopes)
 			return false
 
 		case *ast.KeyValueExpr:
@@ -181,7 +317,7 @@ func (ctxt *context) visitExprs(visitf func(*symInfo) bool, importPath string, p
 
 		case *ast.SelectorExpr:
 			ast.Walk(visit, n.X)
-			ok = ctxt.visitExpr(visitf, importPath, n, local)
+			ok = ctxt.visitExpr(visitf, importPath, n, scopes)
 			return false
 
 		case *ast.File:
@@ -206,7 +342,7 @@ type symInfo struct {
 	universe bool			// whether referred-to object is in universe.
 }
 
-func (ctxt *context) visitExpr(visitf func(*symInfo) bool, importPath string, e ast.Expr, local bool) bool {
+func (ctxt *context) visitExpr(visitf func(*symInfo) bool, importPath string, e ast.Expr, scopes []funcRange) bool {
 	var info symInfo
 	info.expr = e
 	switch e := e.(type) {
@@ -229,7 +365,7 @@ func (ctxt *context) visitExpr(visitf func(*symInfo) bool, importPath string, e
 	} else {
 		info.universe = true
 	}
-	info.local = local
+	info.local = !info.universe && inFuncScope(info.referObj, info.referPos, scopes)
 	return visitf(&info)
 }
 
@@ -305,12 +441,26 @@ func (l symLine) String() string {
 	return fmt.Sprintf("%v: %s %s %s %s%s%s%s", l.pos, l.exprPkg, l.referPkg, l.expr, local, l.kind, def, exprType)
 }
 
-func visitPrint(ctxt *context, info *symInfo, kindMask uint) bool {
+// shouldPrint reports whether info passes the kind mask and -a/-locals-only
+// filtering shared by formatLine and the -members enumeration.
+func shouldPrint(info *symInfo, kindMask uint) bool {
 	if (1<<uint(info.referObj.Kind))&kindMask == 0 {
-		return true
+		return false
 	}
 	if info.universe && !*all {
-		return true
+		return false
+	}
+	if *localsOnly && !info.local {
+		return false
+	}
+	return true
+}
+
+// formatLine renders info as a symLine, or reports ok == false if info
+// is filtered out by kindMask or the -a/-locals-only flags.
+func formatLine(ctxt *context, info *symInfo, kindMask uint) (line string, ok bool) {
+	if !shouldPrint(info, kindMask) {
+		return "", false
 	}
 	eposition := position(info.pos)
 	exprPkg := positionToImportPath(eposition)
@@ -329,7 +479,7 @@ func visitPrint(ctxt *context, info *symInfo, kindMask uint) bool {
 		if xt.Node == nil {
 			if *verbose {
 				log.Printf("%v: no type for %s", position(e.Pos()), pretty{e.X})
-				return true
+				return "", false
 			}
 		}
 		name = e.Sel.Name
@@ -337,20 +487,19 @@ func visitPrint(ctxt *context, info *symInfo, kindMask uint) bool {
 			name = (pretty{depointer(xt.Node)}).String() + "." + name
 		}
 	}
-	line := symLine{
-		pos: eposition,
-		exprPkg: exprPkg,
-		referPkg: referPkg,
-		local: info.local,
-		kind: info.referObj.Kind,
+	l := symLine{
+		pos:        eposition,
+		exprPkg:    exprPkg,
+		referPkg:   referPkg,
+		local:      info.local,
+		kind:       info.referObj.Kind,
 		definition: info.referPos == info.pos,
-		expr: name,
+		expr:       name,
 	}
 	if *printType {
-		line.exprType = (pretty{info.exprType.Node}).String()
+		l.exprType = (pretty{info.exprType.Node}).String()
 	}
-	fmt.Println(line)
-	return true
+	return l.String(), true
 }
 
 func depointer(x ast.Node) ast.Node {
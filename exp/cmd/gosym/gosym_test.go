@@ -0,0 +1,40 @@
+package main
+
+import (
+	"code.google.com/p/rog-go/exp/go/ast"
+	"testing"
+)
+
+// TestInFuncScopeExcludesOwnObj guards against the bug where a top-level
+// func's own name, or a recursive call to it, was classified as
+// function-local because the scope range [start,end) covers the name
+// itself. A reference to the enclosing func's own object must be
+// reported as outside every scope that carries that object, even when
+// its position falls inside the range.
+func TestInFuncScopeExcludesOwnObj(t *testing.T) {
+	fnObj := ast.NewObj(ast.Fun, "f")
+	scopes := []funcRange{{start: 10, end: 20, obj: fnObj}}
+
+	if inFuncScope(fnObj, 15, scopes) {
+		t.Error("reference to the func's own object must not count as local, even inside its range")
+	}
+
+	other := ast.NewObj(ast.Var, "x")
+	if !inFuncScope(other, 15, scopes) {
+		t.Error("reference to a different object inside the range must count as local")
+	}
+	if inFuncScope(other, 25, scopes) {
+		t.Error("reference outside the range must not count as local")
+	}
+}
+
+// TestInFuncScopeFuncLit checks that a FuncLit's scope (obj == nil) does
+// not exempt anything from being local: only a named FuncDecl's own
+// object is special-cased.
+func TestInFuncScopeFuncLit(t *testing.T) {
+	scopes := []funcRange{{start: 10, end: 20, obj: nil}}
+	other := ast.NewObj(ast.Var, "x")
+	if !inFuncScope(other, 15, scopes) {
+		t.Error("reference inside a FuncLit's range must count as local")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"code.google.com/p/rog-go/exp/go/ast"
+	"code.google.com/p/rog-go/exp/go/token"
+	"code.google.com/p/rog-go/exp/go/types"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+var (
+	outputFormat = flag.String("format", "text", "output format: text or json (one JSON object per line)")
+	jsonFlag      = flag.Bool("json", false, "shorthand for -format=json")
+	jsonlIn       = flag.String("jsonl-in", "", "read ndjson produced by -format=json and print it as text, instead of analyzing pkgpath")
+)
+
+// resolveOutputFormat applies the -json shorthand and validates -format,
+// so an unrecognized value is rejected up front instead of silently
+// falling back to text. It also rejects -format=json combined with
+// members, since member lines aren't valid JSON on their own and would
+// otherwise corrupt the one-object-per-line stream.
+func resolveOutputFormat(members bool) (string, error) {
+	format := *outputFormat
+	if *jsonFlag {
+		format = "json"
+	}
+	switch format {
+	case "text":
+		return format, nil
+	case "json":
+		if members {
+			return "", fmt.Errorf("-members is not supported with -format=json; member lines aren't valid JSON on their own")
+		}
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown -format %q (want text or json)", format)
+	}
+}
+
+// jsonLine is the structured form of a symLine: one JSON object per
+// reference, with explicit fields instead of linePat's regexp format,
+// which breaks on filenames containing spaces or colons.
+type jsonLine struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Col        int    `json:"col"`
+	ExprPkg    string `json:"expr_pkg"`
+	ReferPkg   string `json:"refer_pkg"`
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Local      bool   `json:"local"`
+	Universe   bool   `json:"universe"`
+	Definition bool   `json:"definition"`
+	ExprType   string `json:"expr_type,omitempty"`
+	ReferFile  string `json:"refer_file"`
+	ReferLine  int    `json:"refer_line"`
+	ReferCol   int    `json:"refer_col"`
+}
+
+func kindName(k ast.ObjKind) string {
+	for name, kk := range objKinds {
+		if kk == k {
+			return name
+		}
+	}
+	return ""
+}
+
+// formatJSON renders info as a single-line JSON object, applying the
+// same kind-mask/-a/-locals-only filtering as formatLine.
+func formatJSON(ctxt *context, info *symInfo, kindMask uint) (string, bool) {
+	if !shouldPrint(info, kindMask) {
+		return "", false
+	}
+	eposition := position(info.pos)
+	exprPkg := positionToImportPath(eposition)
+	referPosition := position(info.referPos)
+	var referPkg string
+	if info.universe {
+		referPkg = "universe"
+	} else {
+		referPkg = positionToImportPath(referPosition)
+	}
+	var name string
+	switch e := info.expr.(type) {
+	case *ast.Ident:
+		name = e.Name
+	case *ast.SelectorExpr:
+		_, xt := types.ExprType(e.X, ctxt.importer)
+		if xt.Node == nil {
+			if *verbose {
+				log.Printf("%v: no type for %s", position(e.Pos()), pretty{e.X})
+				return "", false
+			}
+		}
+		name = e.Sel.Name
+		if xt.Kind != ast.Pkg {
+			name = (pretty{depointer(xt.Node)}).String() + "." + name
+		}
+	}
+	l := jsonLine{
+		File:       eposition.Filename,
+		Line:       eposition.Line,
+		Col:        eposition.Column,
+		ExprPkg:    exprPkg,
+		ReferPkg:   referPkg,
+		Name:       name,
+		Kind:       kindName(info.referObj.Kind),
+		Local:      info.local,
+		Universe:   info.universe,
+		Definition: info.referPos == info.pos,
+		ReferFile:  referPosition.Filename,
+		ReferLine:  referPosition.Line,
+		ReferCol:   referPosition.Column,
+	}
+	if *printType {
+		l.ExprType = (pretty{info.exprType.Node}).String()
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		log.Printf("gosym: marshaling json: %v", err)
+		return "", false
+	}
+	return string(data), true
+}
+
+// String renders a jsonLine back into the regular text symLine format,
+// so pipelines built around parseSymLine keep working against -format=json
+// output.
+func (l jsonLine) String() string {
+	sl := symLine{
+		pos:        token.Position{Filename: l.File, Line: l.Line, Column: l.Col},
+		exprPkg:    l.ExprPkg,
+		referPkg:   l.ReferPkg,
+		local:      l.Local,
+		kind:       objKinds[l.Kind],
+		definition: l.Definition,
+		expr:       l.Name,
+		exprType:   l.ExprType,
+	}
+	return sl.String()
+}
+
+// runJSONLIn implements -jsonl-in: it streams a file of jsonLine objects,
+// one per line, and prints each back out in the text symLine format.
+func runJSONLIn(name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatalf("gosym: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var l jsonLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			log.Fatalf("gosym: invalid jsonl input: %v", err)
+		}
+		fmt.Println(l.String())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("gosym: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+// TestResolveOutputFormatRejectsJSONWithMembers guards against
+// -format=json and -members being combined: member lines are plain text
+// appended onto the JSON object, which corrupts the one-object-per-line
+// stream for downstream consumers.
+func TestResolveOutputFormatRejectsJSONWithMembers(t *testing.T) {
+	old := *outputFormat
+	defer func() { *outputFormat = old }()
+
+	*outputFormat = "json"
+	if _, err := resolveOutputFormat(true); err == nil {
+		t.Error("resolveOutputFormat(true) with -format=json: got nil error, want a rejection")
+	}
+	if _, err := resolveOutputFormat(false); err != nil {
+		t.Errorf("resolveOutputFormat(false) with -format=json: got %v, want nil", err)
+	}
+
+	*outputFormat = "bogus"
+	if _, err := resolveOutputFormat(false); err == nil {
+		t.Error("resolveOutputFormat with unknown -format: got nil error, want a rejection")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"code.google.com/p/rog-go/exp/go/types"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// BenchmarkAnalyze measures wall time running the worker-pool analysis
+// path (the same one main uses) over a handful of standard library
+// packages, at different -p concurrency levels, as a rough proxy for
+// running gosym over a large GOPATH tree.
+func BenchmarkAnalyze(b *testing.B) {
+	pkgs := []string{"fmt", "strings", "net/http", "encoding/json", "os"}
+	mask, err := parseKindMask(allKinds())
+	if err != nil {
+		b.Fatal(err)
+	}
+	initGoPath()
+	types.Panic = false
+
+	for _, workers := range []int{1, 2, 4, 8, runtime.GOMAXPROCS(0)} {
+		workers := workers
+		b.Run(fmt.Sprintf("p=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ctxt := newContext()
+				analyze(ctxt, pkgs, mask, "text", workers, func(string) {})
+			}
+		})
+	}
+}
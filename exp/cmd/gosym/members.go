@@ -0,0 +1,68 @@
+package main
+
+import (
+	"code.google.com/p/rog-go/exp/go/ast"
+	"code.google.com/p/rog-go/exp/go/token"
+	"code.google.com/p/rog-go/exp/go/types"
+	"flag"
+	"fmt"
+)
+
+var (
+	memberMode = flag.Bool("members", false, "also enumerate methods and fields reachable from each symbol's type")
+	unexported = flag.Bool("unexported", false, "with -members, include unexported methods and fields")
+)
+
+// memberKey dedups members promoted to the same parent symbol via more
+// than one embedding path, so each is only printed once under that
+// parent. It is scoped to a single memberLines call, not shared across
+// the run, since two distinct types may legitimately share a member name.
+type memberKey struct {
+	pkg  string
+	name string
+}
+
+// hasNoSourcePosition reports whether a member has no resolvable source
+// location - e.g. a method promoted from an embedded universe interface
+// like error - in which case positionToImportPath has nothing to map
+// back to a package and must not be called.
+func hasNoSourcePosition(declPos token.Pos, pos token.Position) bool {
+	return declPos == token.NoPos || pos.Filename == ""
+}
+
+// memberLines enumerates the methods and fields of info's resolved type
+// and returns one indented line per member, each with its own
+// declaration position (or "<no position>" for a member that has none)
+// and computed type, for printing under the parent line.
+func memberLines(ctxt *context, info *symInfo) []string {
+	if info.exprType.Node == nil {
+		return nil
+	}
+	var lines []string
+	seen := make(map[memberKey]bool)
+	for obj := range info.exprType.Iter(types.DefaultImporter) {
+		if !*unexported && !ast.IsExported(obj.Name) {
+			continue
+		}
+		declPos := types.DeclPos(obj)
+		if hasNoSourcePosition(declPos, position(declPos)) {
+			key := memberKey{"", obj.Name}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			t, _ := obj.Type.(types.Type)
+			lines = append(lines, fmt.Sprintf("\t<no position>: %s %s", obj.Name, (pretty{t.Node}).String()))
+			continue
+		}
+		pkgpath := positionToImportPath(position(declPos))
+		key := memberKey{pkgpath, obj.Name}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		t, _ := obj.Type.(types.Type)
+		lines = append(lines, fmt.Sprintf("\t%v: %s %s %s", position(declPos), pkgpath, obj.Name, (pretty{t.Node}).String()))
+	}
+	return lines
+}
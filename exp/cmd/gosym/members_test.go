@@ -0,0 +1,28 @@
+package main
+
+import (
+	"code.google.com/p/rog-go/exp/go/token"
+	"testing"
+)
+
+// TestHasNoSourcePosition guards the -members guard against a regression
+// back to calling positionToImportPath (which panics on an empty
+// filename) for members with no source position, such as a method
+// promoted from an embedded universe interface like error.
+func TestHasNoSourcePosition(t *testing.T) {
+	cases := []struct {
+		name    string
+		declPos token.Pos
+		pos     token.Position
+		want    bool
+	}{
+		{"NoPos", token.NoPos, token.Position{}, true},
+		{"empty filename", 1, token.Position{Filename: "", Line: 1}, true},
+		{"real position", 1, token.Position{Filename: "a.go", Line: 1}, false},
+	}
+	for _, c := range cases {
+		if got := hasNoSourcePosition(c.declPos, c.pos); got != c.want {
+			t.Errorf("%s: hasNoSourcePosition() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
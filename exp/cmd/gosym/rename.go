@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"code.google.com/p/rog-go/exp/go/ast"
+	"code.google.com/p/rog-go/exp/go/printer"
+	"code.google.com/p/rog-go/exp/go/token"
+	"code.google.com/p/rog-go/exp/go/types"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var renameFlags = flag.NewFlagSet("rename", flag.ExitOnError)
+var renameDryRun = renameFlags.Bool("dry-run", false, "print a unified diff instead of rewriting files")
+
+func renameUsage() {
+	fmt.Fprintf(os.Stderr, "usage: gosym rename [-dry-run] file:line:col:kind newname pkgpath...\n")
+	os.Exit(2)
+}
+
+// target identifies the declaration to rename.
+type target struct {
+	file string
+	line int
+	col  int
+	kind ast.ObjKind
+}
+
+func parseTarget(s string) (target, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 {
+		return target{}, fmt.Errorf("invalid target %q, want file:line:col:kind", s)
+	}
+	line, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return target{}, fmt.Errorf("invalid line in %q: %v", s, err)
+	}
+	col, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return target{}, fmt.Errorf("invalid column in %q: %v", s, err)
+	}
+	kind, ok := objKinds[parts[3]]
+	if !ok {
+		return target{}, fmt.Errorf("unknown kind %q", parts[3])
+	}
+	return target{parts[0], line, col, kind}, nil
+}
+
+func (t target) matches(p token.Position, kind ast.ObjKind) bool {
+	return kind == t.kind && p.Line == t.line && p.Column == t.col && samePath(p.Filename, t.file)
+}
+
+func samePath(a, b string) bool {
+	return a == b || strings.HasSuffix(a, "/"+b)
+}
+
+// pkgFile pairs a file with the import path gosym resolved it under, so
+// a second visitExprs pass can be made over the same files once the
+// target declaration is known.
+type pkgFile struct {
+	path string
+	file *ast.File
+}
+
+// renamer accumulates the identifiers that must change to newName across
+// every package fed to it, then rewrites the affected files in place.
+type renamer struct {
+	ctxt    *context
+	target  target
+	newName string
+
+	declObj   *ast.Object
+	declPkg   string // import path containing the target declaration.
+	declFile  string // source file containing the target declaration.
+	declLocal bool   // whether the target declaration is function-local.
+
+	files     map[string]*ast.File
+	idents    map[*ast.File][]*ast.Ident
+	colliding bool
+}
+
+func newRenamer(ctxt *context, t target, newName string) *renamer {
+	return &renamer{
+		ctxt:    ctxt,
+		target:  t,
+		newName: newName,
+		files:   make(map[string]*ast.File),
+		idents:  make(map[*ast.File][]*ast.Ident),
+	}
+}
+
+// findDecl is run over every file before anything else, to locate the
+// object the target names. It must complete before visit runs, since
+// visit needs declPkg/declFile/declLocal to scope its collision check.
+func (r *renamer) findDecl(info *symInfo) {
+	if r.declObj != nil || info.referObj == nil {
+		return
+	}
+	declPos := position(info.referPos)
+	if !r.target.matches(declPos, info.referObj.Kind) {
+		return
+	}
+	r.declObj = info.referObj
+	r.declPkg = positionToImportPath(declPos)
+	r.declFile = declPos.Filename
+	r.declLocal = info.local
+}
+
+// visit is called, once the target declaration is known, for every
+// identifier and selector gosym resolves. It records occurrences of the
+// target declaration, and notes any other declaration in the same scope
+// that already uses newName.
+func (r *renamer) visit(info *symInfo) {
+	if info.referObj == nil {
+		return
+	}
+	if info.referObj != r.declObj {
+		if info.referObj.Name == r.newName && r.inDeclScope(info) {
+			r.colliding = true
+		}
+		return
+	}
+	switch e := info.expr.(type) {
+	case *ast.Ident:
+		r.addIdent(e)
+	case *ast.SelectorExpr:
+		// only the selected name is being renamed, never the qualifier.
+		r.addIdent(e.Sel)
+	}
+}
+
+// inDeclScope reports whether info's object could plausibly collide with
+// the target declaration: it must be declared in the same package and,
+// for a function-local target, in the same file (the nearest
+// approximation of "same function" available without a full scope
+// tree), rather than anywhere in any package fed to gosym.
+func (r *renamer) inDeclScope(info *symInfo) bool {
+	pos := position(info.referPos)
+	if positionToImportPath(pos) != r.declPkg {
+		return false
+	}
+	if r.declLocal && pos.Filename != r.declFile {
+		return false
+	}
+	return true
+}
+
+func (r *renamer) addIdent(id *ast.Ident) {
+	f := types.FileSet.File(id.Pos())
+	if f == nil {
+		return
+	}
+	file := r.fileFor(f.Name())
+	if file == nil {
+		return
+	}
+	r.idents[file] = append(r.idents[file], id)
+}
+
+func (r *renamer) fileFor(name string) *ast.File {
+	for fname, f := range r.files {
+		if samePath(fname, name) || samePath(name, fname) {
+			return f
+		}
+	}
+	return nil
+}
+
+// renameImportAlias updates how f imports the renamed package, so that
+// "foo.Bar" becomes "baz.Bar" after "foo" is renamed to "baz": an
+// existing alias is renamed like any other identifier, and a plain
+// "import \"foo/path\"" gets an explicit alias added, since its local
+// name was implicitly the package's old name.
+func (r *renamer) renameImportAlias(f *ast.File) {
+	if r.target.kind != ast.Pkg {
+		return
+	}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			is := spec.(*ast.ImportSpec)
+			if litToString(is.Path) != r.declPkg {
+				continue
+			}
+			if is.Name != nil {
+				r.addIdent(is.Name)
+				continue
+			}
+			is.Name = &ast.Ident{NamePos: is.Path.Pos(), Name: r.newName}
+		}
+	}
+}
+
+func (r *renamer) apply() {
+	for f, idents := range r.idents {
+		for _, id := range idents {
+			id.Name = r.newName
+		}
+		var buf bytes.Buffer
+		if err := printer.Fprint(&buf, types.FileSet, f); err != nil {
+			log.Fatalf("gosym rename: printing %s: %v", f.Name, err)
+		}
+		name := types.FileSet.Position(f.Pos()).Filename
+		if *renameDryRun {
+			printDiff(name, buf.Bytes())
+			continue
+		}
+		if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			log.Fatalf("gosym rename: writing %s: %v", name, err)
+		}
+	}
+}
+
+// diffContext is the number of unchanged lines kept around each change,
+// matching the default of the standard "diff -u".
+const diffContext = 3
+
+// diffOp is one line of an edit script turning a into b: ' ' for a line
+// common to both, '-' for one only in a, '+' for one only in b.
+type diffOp struct {
+	kind    byte
+	oldLine int // 1-based; 0 if this op has no line in a.
+	newLine int // 1-based; 0 if this op has no line in b.
+	text    string
+}
+
+// diffLines computes a minimal edit script from a to b via the classic
+// longest-common-subsequence table.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', i + 1, j + 1, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', i + 1, 0, a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', 0, j + 1, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', i + 1, 0, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', 0, j + 1, b[j]})
+	}
+	return ops
+}
+
+// hunk is one "@@ -oldStart,oldCount +newStart,newCount @@" region of a
+// unified diff.
+type hunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	lines              []string
+}
+
+// groupHunks splits an edit script into hunks, keeping up to context
+// unchanged lines around each run of changes and merging runs that are
+// separated by at most 2*context unchanged lines.
+func groupHunks(ops []diffOp, context int) []hunk {
+	keep := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for d := -context; d <= context; d++ {
+			if k := i + d; k >= 0 && k < len(ops) {
+				keep[k] = true
+			}
+		}
+	}
+	var hunks []hunk
+	for i := 0; i < len(ops); {
+		if !keep[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && keep[j] {
+			j++
+		}
+		hunks = append(hunks, buildHunk(ops[i:j]))
+		i = j
+	}
+	return hunks
+}
+
+func buildHunk(ops []diffOp) hunk {
+	var h hunk
+	for _, op := range ops {
+		if op.oldLine != 0 && h.oldStart == 0 {
+			h.oldStart = op.oldLine
+		}
+		if op.newLine != 0 && h.newStart == 0 {
+			h.newStart = op.newLine
+		}
+		if op.kind != '+' {
+			h.oldCount++
+		}
+		if op.kind != '-' {
+			h.newCount++
+		}
+		h.lines = append(h.lines, string(op.kind)+op.text)
+	}
+	if h.oldStart == 0 {
+		h.oldStart = 1
+	}
+	if h.newStart == 0 {
+		h.newStart = 1
+	}
+	return h
+}
+
+// printDiff prints a real unified diff (with "@@ -l,s +l,s @@" hunk
+// headers) between name's current contents and newSrc, in the style of
+// "diff -u", so -dry-run output applies with patch/git apply.
+func printDiff(name string, newSrc []byte) {
+	oldSrc, err := ioutil.ReadFile(name)
+	if err != nil {
+		log.Fatalf("gosym rename: %v", err)
+	}
+	if bytes.Equal(oldSrc, newSrc) {
+		return
+	}
+	oldLines := strings.Split(string(oldSrc), "\n")
+	newLines := strings.Split(string(newSrc), "\n")
+	hunks := groupHunks(diffLines(oldLines, newLines), diffContext)
+	if len(hunks) == 0 {
+		return
+	}
+	fmt.Printf("--- a/%s\n+++ b/%s\n", name, name)
+	for _, h := range hunks {
+		fmt.Printf("@@ -%d,%d +%d,%d @@\n", h.oldStart, h.oldCount, h.newStart, h.newCount)
+		for _, l := range h.lines {
+			fmt.Println(l)
+		}
+	}
+}
+
+// runRename implements the "rename" subcommand: it finds the declaration
+// identified by t, renames every occurrence of it reachable from pkgs to
+// newName, and rewrites the affected files in place (or prints a unified
+// diff, with -dry-run).
+func runRename(args []string) {
+	renameFlags.Usage = renameUsage
+	renameFlags.Parse(args)
+	args = renameFlags.Args()
+	if len(args) < 3 {
+		renameUsage()
+	}
+	t, err := parseTarget(args[0])
+	if err != nil {
+		log.Fatalf("gosym rename: %v", err)
+	}
+	newName := args[1]
+	pkgs := args[2:]
+
+	initGoPath()
+	ctxt := newContext()
+	types.Panic = false
+
+	r := newRenamer(ctxt, t, newName)
+	var order []pkgFile
+	for _, path := range pkgs {
+		pkg := ctxt.importer(path)
+		if pkg == nil {
+			continue
+		}
+		for fname, f := range pkg.Files {
+			r.files[fname] = f
+			order = append(order, pkgFile{path, f})
+			ctxt.visitExprs(func(info *symInfo) bool {
+				r.findDecl(info)
+				return true
+			}, path, f, ^uint(0))
+		}
+	}
+	if r.declObj == nil {
+		log.Fatalf("gosym rename: no declaration found at %s:%d:%d", t.file, t.line, t.col)
+	}
+	// Only now, with declPkg/declFile/declLocal known, can collisions be
+	// scoped correctly, so occurrences are collected in a second pass.
+	for _, of := range order {
+		ctxt.visitExprs(func(info *symInfo) bool {
+			r.visit(info)
+			return true
+		}, of.path, of.file, ^uint(0))
+	}
+	if r.colliding {
+		log.Fatalf("gosym rename: %q is already declared in this scope", newName)
+	}
+	for _, f := range r.files {
+		r.renameImportAlias(f)
+	}
+	r.apply()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDiffLinesAndGroupHunks guards against printDiff regressing into a
+// naive positional line-compare: a single inserted line must not push
+// every following unchanged line into the hunk as changed, and the
+// resulting hunk must carry real "@@ -l,s +l,s @@" coordinates.
+func TestDiffLinesAndGroupHunks(t *testing.T) {
+	a := []string{"one", "two", "three", "four", "five"}
+	b := []string{"one", "inserted", "two", "three", "four", "five"}
+
+	ops := diffLines(a, b)
+	hunks := groupHunks(ops, diffContext)
+	if len(hunks) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(hunks))
+	}
+	h := hunks[0]
+	if h.oldStart != 1 || h.newStart != 1 {
+		t.Errorf("got oldStart=%d newStart=%d, want 1,1", h.oldStart, h.newStart)
+	}
+
+	var kinds []byte
+	for _, l := range h.lines {
+		kinds = append(kinds, l[0])
+	}
+	// diffContext (3) unchanged lines follow the insertion; "five" is
+	// beyond them and so falls outside the hunk.
+	want := []byte{' ', '+', ' ', ' ', ' '}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("got line kinds %q, want %q; a single insertion must not mark the unchanged tail as changed", kinds, want)
+	}
+}
+
+// TestGroupHunksSplitsDistantChanges checks that two changes far enough
+// apart (beyond diffContext on both sides) produce two separate hunks
+// rather than one hunk spanning the whole file.
+func TestGroupHunksSplitsDistantChanges(t *testing.T) {
+	a := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		a = append(a, "line")
+	}
+	b := append([]string{}, a...)
+	b[1] = "changed-near-start"
+	b[18] = "changed-near-end"
+
+	hunks := groupHunks(diffLines(a, b), diffContext)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2 for two widely separated changes", len(hunks))
+	}
+}